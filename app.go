@@ -2,22 +2,28 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
-	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Units
@@ -33,12 +39,53 @@ var cert string
 var key string
 var port string
 var metricsEnabled bool
+var metricsFormat string
+var metricsBucketsFlag string
+var dataStreamThreshold int64
+var serverBackend string
+var readHeaderTimeout time.Duration
+var readTimeout time.Duration
+var writeTimeout time.Duration
+var idleTimeout time.Duration
+var maxHeaderBytes int
+var shutdownTimeout time.Duration
+var h2cEnabled bool
+var wsPingInterval time.Duration
+var wsMaxConns int64
+var wsCompression bool
+var accessLogEnabled bool
+var logFormat string
+var logOutputDest string
+var accessLogWriter io.Writer
+
+// Supported values for -server.
+const (
+	serverBackendNetHTTP  = "net/http"
+	serverBackendFasthttp = "fasthttp"
+)
 
 func init() {
 	flag.StringVar(&cert, "cert", "", "give me a certificate")
 	flag.StringVar(&key, "key", "", "give me a key")
 	flag.StringVar(&port, "port", "80", "give me a port number")
 	flag.BoolVar(&metricsEnabled, "metrics", false, "enable collecting metrics")
+	flag.StringVar(&metricsFormat, "metrics-format", metricsFormatExpvar, "metrics sink to publish: expvar, prometheus or both")
+	flag.StringVar(&metricsBucketsFlag, "metrics-buckets", "", "comma-separated request duration histogram buckets in seconds (prometheus format only)")
+	flag.Int64Var(&dataStreamThreshold, "data-stream-threshold", MB, "size in bytes above which /data streams its response instead of buffering it")
+	flag.StringVar(&serverBackend, "server", serverBackendNetHTTP, "server backend to use: net/http or fasthttp")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 5*time.Second, "timeout for reading request headers")
+	flag.DurationVar(&readTimeout, "read-timeout", 0, "timeout for reading the full request, 0 means no timeout")
+	flag.DurationVar(&writeTimeout, "write-timeout", 0, "timeout for writing the response, 0 means no timeout")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 120*time.Second, "keep-alive idle timeout")
+	flag.IntVar(&maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of request headers in bytes")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "grace period for in-flight requests to finish on shutdown")
+	flag.BoolVar(&h2cEnabled, "h2c", false, "enable HTTP/2 cleartext (h2c) support")
+	flag.DurationVar(&wsPingInterval, "ws-ping-interval", 30*time.Second, "interval between websocket ping frames")
+	flag.Int64Var(&wsMaxConns, "ws-max-conns", 1000, "maximum concurrent websocket connections, 0 means unlimited")
+	flag.BoolVar(&wsCompression, "ws-compression", false, "enable permessage-deflate compression for websocket connections")
+	flag.BoolVar(&accessLogEnabled, "access-log", false, "enable structured access logging")
+	flag.StringVar(&logFormat, "log-format", logFormatJSON, "access log format: json, logfmt or clf")
+	flag.StringVar(&logOutputDest, "log-output", "stdout", "access log destination: stdout, stderr or file:<path>")
 }
 
 var upgrader = websocket.Upgrader{
@@ -48,44 +95,199 @@ var upgrader = websocket.Upgrader{
 
 func main() {
 	flag.Parse()
+	upgrader.EnableCompression = wsCompression
+
+	if accessLogEnabled {
+		w, err := openAccessLogWriter(logOutputDest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		accessLogWriter = w
+	}
+
+	var metricsHandler http.Handler
 	if metricsEnabled {
-		publishExpvarMetrics()
+		switch metricsFormat {
+		case metricsFormatExpvar:
+			publishExpvarMetrics()
+		case metricsFormatPrometheus:
+			metricsHandler = publishPrometheusMetrics(parseMetricsBuckets(metricsBucketsFlag))
+		case metricsFormatBoth:
+			publishExpvarMetrics()
+			metricsHandler = publishPrometheusMetrics(parseMetricsBuckets(metricsBucketsFlag))
+		default:
+			log.Fatalf("invalid -metrics-format %q: must be one of expvar, prometheus, both", metricsFormat)
+		}
+	}
+
+	if serverBackend == serverBackendFasthttp {
+		fmt.Println("Starting up (fasthttp) on port " + port)
+		log.Fatal(runFasthttpServer(":"+port, metricsHandler))
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data", wrapHandler("/data", dataHandler))
+	mux.HandleFunc("/echo", wrapHandler("/echo", echoHandler))
+	mux.HandleFunc("/bench", wrapHandler("/bench", benchHandler))
+	mux.HandleFunc("/", wrapHandler("/", whoamiHandler))
+	mux.HandleFunc("/api", wrapHandler("/api", apiHandler))
+	mux.HandleFunc("/health", wrapHandler("/health", healthHandler))
+
+	// expvar and net/http/pprof register themselves on http.DefaultServeMux
+	// at init time; forward their prefixes here since mux (not
+	// DefaultServeMux) is what actually serves requests below.
+	mux.Handle("/debug/vars", http.DefaultServeMux)
+	mux.Handle("/debug/pprof/", http.DefaultServeMux)
+	if metricsHandler != nil {
+		mux.Handle("/metrics", metricsHandler)
+	}
+
+	var handler http.Handler = mux
+	if h2cEnabled {
+		handler = h2c.NewHandler(mux, &http2.Server{})
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+
+	useTLS := len(cert) > 0 && len(key) > 0
+	if useTLS {
+		if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	http.HandleFunc("/data", wrapHandler(dataHandler))
-	http.HandleFunc("/echo", wrapHandler(echoHandler))
-	http.HandleFunc("/bench", wrapHandler(benchHandler))
-	http.HandleFunc("/", wrapHandler(whoamiHandler))
-	http.HandleFunc("/api", wrapHandler(apiHandler))
-	http.HandleFunc("/health", wrapHandler(healthHandler))
+	go handleShutdownSignals(server)
 
 	fmt.Println("Starting up on port " + port)
 
-	if len(cert) > 0 && len(key) > 0 {
-		log.Fatal(http.ListenAndServeTLS(":"+port, cert, key, nil))
+	var err error
+	if useTLS {
+		err = server.ListenAndServeTLS(cert, key)
+	} else {
+		err = server.ListenAndServe()
 	}
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// handleShutdownSignals waits for SIGINT/SIGTERM, flips the health check to
+// 503 so load balancers start draining traffic, then gives in-flight
+// requests -shutdown-timeout to finish before the process exits.
+func handleShutdownSignals(server *http.Server) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	fmt.Println("Shutting down...")
+	beginShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("graceful shutdown failed:", err)
+	}
+}
+
+var shuttingDown int32
+
+func beginShutdown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
 }
 
-func wrapHandler(handler http.HandlerFunc) http.HandlerFunc {
-	if !metricsEnabled {
-		return handler
+func wrapHandler(path string, handler http.HandlerFunc) http.HandlerFunc {
+	wrapped := handler
+	if metricsEnabled {
+		wrapped = metricsMiddleware{nextHandler: wrapped, path: path}.ServeHTTP
+	}
+	if accessLogEnabled {
+		wrapped = loggingMiddleware{nextHandler: wrapped, writer: accessLogWriter}.ServeHTTP
 	}
-	return metricsMiddleware{nextHandler: handler}.ServeHTTP
+	return wrapped
 }
 
-func benchHandler(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Content-Type", "text/plain")
-	_, _ = fmt.Fprint(w, "1")
+var benchBody = []byte("1")
+
+// benchCore lets /bench be measured for zero-allocation steady state
+// regardless of which server backend is selected via -server.
+func benchCore(ctx reqCtx) {
+	ctx.SetHeader("Connection", "keep-alive")
+	ctx.SetHeader("Content-Type", "text/plain")
+	_, _ = ctx.Write(benchBody)
+}
+
+func benchHandler(w http.ResponseWriter, r *http.Request) {
+	benchCore(newNetHTTPCtx(w, r))
+}
+
+const (
+	wsMaxMessageSize = 32 * 1024
+	wsWriteTimeout   = 10 * time.Second
+)
+
+var wsConnCount int64
+
+// acquireWSConn reserves a slot out of -ws-max-conns, returning false once
+// the cap is reached (0 means unlimited).
+func acquireWSConn() bool {
+	if wsMaxConns <= 0 {
+		atomic.AddInt64(&wsConnCount, 1)
+		return true
+	}
+	for {
+		cur := atomic.LoadInt64(&wsConnCount)
+		if cur >= wsMaxConns {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&wsConnCount, cur, cur+1) {
+			return true
+		}
+	}
+}
+
+func releaseWSConn() {
+	atomic.AddInt64(&wsConnCount, -1)
 }
 
 func echoHandler(w http.ResponseWriter, r *http.Request) {
+	if !acquireWSConn() {
+		http.Error(w, "too many concurrent websocket connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer releaseWSConn()
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	defer conn.Close()
+
+	wsActiveConnections.Add(1)
+	defer wsActiveConnections.Add(-1)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPingInterval + wsWriteTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPingInterval + wsWriteTimeout))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go wsPingLoop(conn, done)
 
 	for {
 		messageType, p, err := conn.ReadMessage()
@@ -94,13 +296,31 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		printBinary(p)
-		err = conn.WriteMessage(messageType, p)
-		if err != nil {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(messageType, p); err != nil {
 			return
 		}
 	}
 }
 
+// wsPingLoop keeps a single connection alive by writing a ping frame every
+// -ws-ping-interval until done is closed or a write fails.
+func wsPingLoop(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func printBinary(s []byte) {
 	fmt.Printf("Received b:")
 	for n := 0; n < len(s); n++ {
@@ -112,11 +332,33 @@ func printBinary(s []byte) {
 // ################################################################################################
 // DATA
 
+// dataHandler handles the net/http-specific attachment case (it needs
+// http.ServeContent's Range support) and otherwise delegates to dataCore,
+// shared with the fasthttp backend.
 func dataHandler(w http.ResponseWriter, r *http.Request) {
-	u, _ := url.Parse(r.URL.String())
-	queryParams := u.Query()
+	ctx := newNetHTTPCtx(w, r)
 
-	size, err := strconv.ParseInt(queryParams.Get("size"), 10, 64)
+	attachment, err := strconv.ParseBool(ctx.Query("attachment"))
+	if err != nil {
+		attachment = false
+	}
+	if attachment {
+		size := parseDataSize(ctx)
+		w.Header().Add("Content-Disposition", "Attachment")
+		http.ServeContent(w, r, "data.txt", time.Now(), newContentGenerator(size))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var flush func()
+	if flusher != nil {
+		flush = flusher.Flush
+	}
+	dataCore(ctx, flush)
+}
+
+func parseDataSize(ctx reqCtx) int64 {
+	size, err := strconv.ParseInt(ctx.Query("size"), 10, 64)
 	if err != nil {
 		size = 1
 	}
@@ -124,8 +366,7 @@ func dataHandler(w http.ResponseWriter, r *http.Request) {
 		size = 0
 	}
 
-	unit := queryParams.Get("unit")
-	switch strings.ToLower(unit) {
+	switch strings.ToLower(ctx.Query("unit")) {
 	case "kb":
 		size *= KB
 	case "mb":
@@ -135,23 +376,41 @@ func dataHandler(w http.ResponseWriter, r *http.Request) {
 	case "tb":
 		size *= TB
 	}
+	return size
+}
 
-	attachment, err := strconv.ParseBool(queryParams.Get("attachment"))
+// dataStreamParams resolves the /data size and stream-or-buffer decision
+// from the request, shared with the fasthttp backend's own streaming path
+// (see fasthttp_server.go) so both agree on when to stream.
+func dataStreamParams(ctx reqCtx) (size int64, stream bool) {
+	size = parseDataSize(ctx)
+	stream, err := strconv.ParseBool(ctx.Query("stream"))
 	if err != nil {
-		attachment = false
+		stream = size > dataStreamThreshold
 	}
+	return size, stream
+}
 
-	content := fillContentPooled(size)
-	defer content.Close()
-
-	if attachment {
-		w.Header().Add("Content-Disposition", "Attachment")
-		http.ServeContent(w, r, "data.txt", time.Now(), bytes.NewReader(content.Bytes()))
+// dataCore serves the /data response for both server backends. The
+// attachment+Range case stays net/http-only (see dataHandler) since
+// fasthttp has no equivalent to http.ServeContent.
+func dataCore(ctx reqCtx, flush func()) {
+	size, stream := dataStreamParams(ctx)
+
+	ctx.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	if stream {
+		ctx.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+		if err := streamContentTo(ctx, size, flush); err != nil {
+			ctx.Error(err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	if _, err := io.Copy(w, content); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	content := fillContentPooled(size)
+	defer content.Close()
+
+	if _, err := io.Copy(ctx, content); err != nil {
+		ctx.Error(err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
@@ -191,9 +450,8 @@ const CHARSET = "-ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 // ################################################################################################
 // WHOAMI
 
-func whoamiHandler(w http.ResponseWriter, req *http.Request) {
-	u, _ := url.Parse(req.URL.String())
-	wait := u.Query().Get("wait")
+func whoamiCore(ctx reqCtx) {
+	wait := ctx.Query("wait")
 	if len(wait) > 0 {
 		duration, err := time.ParseDuration(wait)
 		if err == nil {
@@ -206,15 +464,22 @@ func whoamiHandler(w http.ResponseWriter, req *http.Request) {
 		writeHostInfo(&b)
 		hostInfo = b.String()
 	})
-	_, _ = fmt.Fprint(w, hostInfo)
+	_, _ = fmt.Fprint(ctx, hostInfo)
 
-	_, _ = fmt.Fprintln(w, "RemoteAddr:", req.RemoteAddr)
-	if err := req.Write(w); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	_, _ = fmt.Fprintln(ctx, "RemoteAddr:", ctx.RemoteAddr())
+	if requestID := ctx.RequestID(); requestID != "" {
+		_, _ = fmt.Fprintln(ctx, "RequestID:", requestID)
+	}
+	if err := writeRawRequest(ctx); err != nil {
+		ctx.Error(err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+func whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	whoamiCore(newNetHTTPCtx(w, r))
+}
+
 func writeHostInfo(w io.Writer) {
 	hostname, _ := os.Hostname()
 	_, _ = fmt.Fprintln(w, "Hostname:", hostname)
@@ -241,23 +506,25 @@ var hostInfoOnce = sync.Once{}
 
 // ################################################################################################
 
-func apiHandler(w http.ResponseWriter, req *http.Request) {
+func apiCore(ctx reqCtx) {
 	hostname, _ := os.Hostname()
 
 	data := struct {
-		Hostname string      `json:"hostname,omitempty"`
-		IP       []string    `json:"ip,omitempty"`
-		Headers  http.Header `json:"headers,omitempty"`
-		URL      string      `json:"url,omitempty"`
-		Host     string      `json:"host,omitempty"`
-		Method   string      `json:"method,omitempty"`
+		Hostname  string      `json:"hostname,omitempty"`
+		IP        []string    `json:"ip,omitempty"`
+		Headers   http.Header `json:"headers,omitempty"`
+		URL       string      `json:"url,omitempty"`
+		Host      string      `json:"host,omitempty"`
+		Method    string      `json:"method,omitempty"`
+		RequestID string      `json:"requestId,omitempty"`
 	}{
-		Hostname: hostname,
-		IP:       []string{},
-		Headers:  req.Header,
-		URL:      req.URL.RequestURI(),
-		Host:     req.Host,
-		Method:   req.Method,
+		Hostname:  hostname,
+		IP:        []string{},
+		Headers:   headersMap(ctx.Headers()),
+		URL:       ctx.RequestURI(),
+		Host:      ctx.Host(),
+		Method:    ctx.Method(),
+		RequestID: ctx.RequestID(),
 	}
 
 	ifaces, _ := net.Interfaces()
@@ -278,37 +545,175 @@ func apiHandler(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	ctx.SetHeader("Content-Type", "application/json")
+	if err := json.NewEncoder(ctx).Encode(data); err != nil {
+		ctx.Error(err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	apiCore(newNetHTTPCtx(w, r))
+}
+
+// healthTransition schedules a status code change applied after the
+// previous transition (or the state install, for the first one) has
+// elapsed.
+type healthTransition struct {
+	After  time.Duration
+	Status int
+}
+
 type healthState struct {
-	StatusCode int
+	StatusCode  int
+	Latency     time.Duration
+	FailRatio   float64
+	FailStatus  int
+	Transitions []healthTransition
+}
+
+// healthTransitionSpec and healthStateSpec mirror the wire format accepted
+// by POST /health, where durations are human-readable strings (e.g.
+// "150ms") rather than healthState's parsed time.Duration.
+type healthTransitionSpec struct {
+	After  string `json:"after"`
+	Status int    `json:"status"`
+}
+
+type healthStateSpec struct {
+	Status      int                    `json:"status"`
+	Latency     string                 `json:"latency"`
+	FailRatio   float64                `json:"failRatio"`
+	FailStatus  int                    `json:"failStatus"`
+	Transitions []healthTransitionSpec `json:"transitions"`
+}
+
+func newHealthStateFromSpec(spec healthStateSpec) (healthState, error) {
+	state := healthState{
+		StatusCode: spec.Status,
+		FailRatio:  spec.FailRatio,
+		FailStatus: spec.FailStatus,
+	}
+	if state.StatusCode == 0 {
+		state.StatusCode = http.StatusOK
+	}
+	if state.FailStatus == 0 {
+		state.FailStatus = http.StatusServiceUnavailable
+	}
+
+	if spec.Latency != "" {
+		d, err := time.ParseDuration(spec.Latency)
+		if err != nil {
+			return healthState{}, fmt.Errorf("invalid latency %q: %w", spec.Latency, err)
+		}
+		state.Latency = d
+	}
+
+	for _, t := range spec.Transitions {
+		d, err := time.ParseDuration(t.After)
+		if err != nil {
+			return healthState{}, fmt.Errorf("invalid transition after %q: %w", t.After, err)
+		}
+		state.Transitions = append(state.Transitions, healthTransition{After: d, Status: t.Status})
+	}
+	return state, nil
 }
 
-var currentHealthState = healthState{http.StatusOK}
+var currentHealthState = healthState{StatusCode: http.StatusOK}
 var mutexHealthState = &sync.RWMutex{}
+var healthTransitionsCancel context.CancelFunc
+
+// installHealthState replaces the current health state, cancelling any
+// transitions scheduled by a previous state and starting a background
+// goroutine to apply the new one's transitions in order.
+func installHealthState(state healthState) {
+	mutexHealthState.Lock()
+	if healthTransitionsCancel != nil {
+		healthTransitionsCancel()
+	}
+	currentHealthState = state
+	ctx, cancel := context.WithCancel(context.Background())
+	healthTransitionsCancel = cancel
+	transitions := state.Transitions
+	mutexHealthState.Unlock()
+
+	if len(transitions) > 0 {
+		go runHealthTransitions(ctx, transitions)
+	}
+}
+
+func runHealthTransitions(ctx context.Context, transitions []healthTransition) {
+	for _, t := range transitions {
+		timer := time.NewTimer(t.After)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		mutexHealthState.Lock()
+		currentHealthState.StatusCode = t.Status
+		mutexHealthState.Unlock()
+		fmt.Printf("Health check scheduled transition to status [%d]\n", t.Status)
+	}
+}
+
+// healthCore's POST accepts either a bare integer status code (preserved
+// for backward compatibility) or a richer JSON healthStateSpec describing
+// latency, a random failure ratio, and scheduled transitions.
+func healthCore(ctx reqCtx) {
+	if ctx.Method() == http.MethodPost {
+		body, err := io.ReadAll(ctx.Body())
+		if err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
 
-func healthHandler(w http.ResponseWriter, req *http.Request) {
-	if req.Method == http.MethodPost {
 		var statusCode int
+		if err := json.Unmarshal(body, &statusCode); err == nil {
+			fmt.Printf("Update health check status code [%d]\n", statusCode)
+			installHealthState(healthState{StatusCode: statusCode})
+			return
+		}
 
-		if err := json.NewDecoder(req.Body).Decode(&statusCode); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		var spec healthStateSpec
+		if err := json.Unmarshal(body, &spec); err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
+		state, err := newHealthStateFromSpec(spec)
+		if err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		fmt.Printf("Update health check status code [%d]\n", statusCode)
+		fmt.Printf("Update health check state: status=%d latency=%s failRatio=%.2f failStatus=%d transitions=%d\n",
+			state.StatusCode, state.Latency, state.FailRatio, state.FailStatus, len(state.Transitions))
+		installHealthState(state)
+		return
+	}
 
-		mutexHealthState.Lock()
-		defer mutexHealthState.Unlock()
-		currentHealthState.StatusCode = statusCode
-	} else {
-		mutexHealthState.RLock()
-		defer mutexHealthState.RUnlock()
-		w.WriteHeader(currentHealthState.StatusCode)
+	if isShuttingDown() {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		return
+	}
+
+	mutexHealthState.RLock()
+	state := currentHealthState
+	mutexHealthState.RUnlock()
+
+	if state.Latency > 0 {
+		time.Sleep(state.Latency)
 	}
+
+	status := state.StatusCode
+	if state.FailRatio > 0 && rand.Float64() < state.FailRatio {
+		status = state.FailStatus
+	}
+	ctx.SetStatusCode(status)
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	healthCore(newNetHTTPCtx(w, r))
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBenchHandlerOverHTTP exercises benchCore through an actual
+// net/http request/response pair, complementing TestBenchCoreAllocFree's
+// fake-reqCtx allocation check with an end-to-end sanity check of what
+// /bench actually sends on the wire.
+func TestBenchHandlerOverHTTP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/bench", nil)
+	rec := httptest.NewRecorder()
+
+	benchHandler(rec, req)
+
+	if got, want := rec.Body.String(), "1"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "text/plain"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Connection"), "keep-alive"; got != want {
+		t.Errorf("Connection = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+// discardCtx is a minimal reqCtx that discards everything it's given. It
+// isolates benchCore's own allocation behavior from whichever transport
+// (net/http or fasthttp) ends up calling it.
+type discardCtx struct{ headers map[string]string }
+
+func (c *discardCtx) Write(p []byte) (int, error)    { return len(p), nil }
+func (c *discardCtx) Method() string                 { return "GET" }
+func (c *discardCtx) Path() string                   { return "/bench" }
+func (c *discardCtx) RequestURI() string             { return "/bench" }
+func (c *discardCtx) Query(string) string            { return "" }
+func (c *discardCtx) Header(string) string           { return "" }
+func (c *discardCtx) Headers() []headerKV            { return nil }
+func (c *discardCtx) Host() string                   { return "localhost" }
+func (c *discardCtx) RemoteAddr() string             { return "127.0.0.1:0" }
+func (c *discardCtx) RequestID() string              { return "" }
+func (c *discardCtx) Body() io.Reader                { return nil }
+func (c *discardCtx) SetHeader(key, value string)    { c.headers[key] = value }
+func (c *discardCtx) SetStatusCode(int)              {}
+func (c *discardCtx) Error(message string, code int) {}
+
+func TestBenchCoreAllocFree(t *testing.T) {
+	ctx := &discardCtx{headers: make(map[string]string)}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		benchCore(ctx)
+	})
+	if allocs != 0 {
+		t.Errorf("benchCore allocated %.0f times per call, want 0", allocs)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// contentGenerator is an io.ReadSeeker that produces the CHARSET pattern on
+// the fly, without ever materializing the full payload in memory. It backs
+// attachment downloads so http.ServeContent can still honor Range requests
+// over arbitrarily large sizes.
+type contentGenerator struct {
+	length int64
+	pos    int64
+}
+
+func newContentGenerator(length int64) *contentGenerator {
+	return &contentGenerator{length: length}
+}
+
+func (g *contentGenerator) Read(p []byte) (int, error) {
+	if g.pos >= g.length {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && g.pos < g.length {
+		p[n] = contentByteAt(g.pos, g.length)
+		g.pos++
+		n++
+	}
+	return n, nil
+}
+
+func (g *contentGenerator) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = g.pos + offset
+	case io.SeekEnd:
+		newPos = g.length + offset
+	default:
+		return 0, fmt.Errorf("contentGenerator: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, fmt.Errorf("contentGenerator: negative resulting position")
+	}
+	g.pos = newPos
+	return g.pos, nil
+}
+
+// contentByteAt returns the byte at position i of the CHARSET pattern for a
+// payload of the given total length, matching writeContent's layout: the
+// first and last bytes are '|' delimiters, everything in between cycles
+// through CHARSET.
+func contentByteAt(i, length int64) byte {
+	if i == 0 {
+		return '|'
+	}
+	if length > 1 && i == length-1 {
+		return '|'
+	}
+	return CHARSET[int(i)%len(CHARSET)]
+}
+
+const streamChunkSize = 32 * 1024
+
+var streamChunkPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, streamChunkSize)
+		return &b
+	},
+}
+
+// streamContentTo writes length bytes of the CHARSET pattern directly to w
+// in fixed-size chunks drawn from a pool, calling flush (if non-nil) after
+// each one so large payloads never need to be buffered in memory and both
+// the net/http and fasthttp handlers can share it.
+func streamContentTo(w io.Writer, length int64, flush func()) error {
+	chunkPtr := streamChunkPool.Get().(*[]byte)
+	defer streamChunkPool.Put(chunkPtr)
+	chunk := *chunkPtr
+
+	for pos := int64(0); pos < length; {
+		n := int64(len(chunk))
+		if remaining := length - pos; remaining < n {
+			n = remaining
+		}
+		for i := int64(0); i < n; i++ {
+			chunk[i] = contentByteAt(pos+i, length)
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return err
+		}
+		pos += n
+		if flush != nil {
+			flush()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestStreamContentToMatchesWriteContent(t *testing.T) {
+	for _, size := range []int64{0, 1, 2, 3, 100, streamChunkSize, streamChunkSize + 1, streamChunkSize*2 + 17} {
+		var want bytes.Buffer
+		writeContent(&want, size)
+
+		var got bytes.Buffer
+		if err := streamContentTo(&got, size, nil); err != nil {
+			t.Fatalf("streamContentTo(size=%d): %v", size, err)
+		}
+
+		if !bytes.Equal(want.Bytes(), got.Bytes()) {
+			t.Errorf("size=%d: streamContentTo produced different bytes than writeContent", size)
+		}
+	}
+}
+
+func TestStreamContentToCallsFlushPerChunk(t *testing.T) {
+	size := streamChunkSize*3 + 5
+	var flushes int
+	var buf bytes.Buffer
+	if err := streamContentTo(&buf, int64(size), func() { flushes++ }); err != nil {
+		t.Fatalf("streamContentTo: %v", err)
+	}
+	if want := 4; flushes != want {
+		t.Errorf("flush called %d times, want %d", flushes, want)
+	}
+}
+
+func TestContentGeneratorMatchesWriteContent(t *testing.T) {
+	for _, size := range []int64{0, 1, 2, 3, 100} {
+		var want bytes.Buffer
+		writeContent(&want, size)
+
+		g := newContentGenerator(size)
+		got, err := readAll(g)
+		if err != nil {
+			t.Fatalf("size=%d: %v", size, err)
+		}
+
+		if !bytes.Equal(want.Bytes(), got) {
+			t.Errorf("size=%d: contentGenerator produced different bytes than writeContent", size)
+		}
+	}
+}
+
+func readAll(g *contentGenerator) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, 7)
+	for {
+		n, err := g.Read(buf)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			if err == io.EOF {
+				return out, nil
+			}
+			return out, err
+		}
+	}
+}
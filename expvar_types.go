@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// expvarInt is an expvar.Var-compatible int64 counter. Unlike the standard
+// library's expvar.Int, Add returns the updated total so callers (e.g.
+// metricsMiddleware tracking concurrent requests) don't need a separate
+// read to react to it.
+type expvarInt struct {
+	value int64
+}
+
+func (v *expvarInt) Add(delta int64) int64 {
+	return atomic.AddInt64(&v.value, delta)
+}
+
+func (v *expvarInt) Value() int64 {
+	return atomic.LoadInt64(&v.value)
+}
+
+func (v *expvarInt) String() string {
+	return strconv.FormatInt(v.Value(), 10)
+}
+
+// expvarMaxInt is an expvar.Var tracking the highest value ever passed to
+// Update, used for maxConcurrentRequestCount.
+type expvarMaxInt struct {
+	value int64
+}
+
+func (v *expvarMaxInt) Update(n int64) {
+	for {
+		cur := atomic.LoadInt64(&v.value)
+		if n <= cur || atomic.CompareAndSwapInt64(&v.value, cur, n) {
+			return
+		}
+	}
+}
+
+func (v *expvarMaxInt) Value() int64 {
+	return atomic.LoadInt64(&v.value)
+}
+
+func (v *expvarMaxInt) String() string {
+	return strconv.FormatInt(v.Value(), 10)
+}
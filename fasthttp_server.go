@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// fasthttpCtx adapts a *fasthttp.RequestCtx to reqCtx so whoamiCore,
+// dataCore, apiCore, healthCore and benchCore run unchanged on the
+// fasthttp backend.
+type fasthttpCtx struct {
+	ctx *fasthttp.RequestCtx
+}
+
+func (c *fasthttpCtx) Write(p []byte) (int, error) { return c.ctx.Write(p) }
+func (c *fasthttpCtx) Method() string              { return string(c.ctx.Method()) }
+func (c *fasthttpCtx) Path() string                { return string(c.ctx.Path()) }
+func (c *fasthttpCtx) RequestURI() string          { return string(c.ctx.RequestURI()) }
+func (c *fasthttpCtx) Query(key string) string     { return string(c.ctx.QueryArgs().Peek(key)) }
+func (c *fasthttpCtx) Header(key string) string    { return string(c.ctx.Request.Header.Peek(key)) }
+func (c *fasthttpCtx) Host() string                { return string(c.ctx.Host()) }
+func (c *fasthttpCtx) RemoteAddr() string          { return c.ctx.RemoteAddr().String() }
+
+// RequestID always returns "" on the fasthttp backend: -access-log's
+// loggingMiddleware only wraps the net/http mux for now.
+func (c *fasthttpCtx) RequestID() string              { return "" }
+func (c *fasthttpCtx) Body() io.Reader                { return bytes.NewReader(c.ctx.PostBody()) }
+func (c *fasthttpCtx) SetHeader(key, value string)    { c.ctx.Response.Header.Set(key, value) }
+func (c *fasthttpCtx) SetStatusCode(code int)         { c.ctx.SetStatusCode(code) }
+func (c *fasthttpCtx) Error(message string, code int) { c.ctx.Error(message, code) }
+
+func (c *fasthttpCtx) Headers() []headerKV {
+	headers := make([]headerKV, 0)
+	c.ctx.Request.Header.VisitAll(func(key, value []byte) {
+		headers = append(headers, headerKV{Key: string(key), Value: string(value)})
+	})
+	return headers
+}
+
+// fasthttpMetricsHandler adapts the Prometheus handler from
+// publishPrometheusMetrics to fasthttp's RequestHandler signature, set up
+// once by runFasthttpServer so /metrics is reachable on this backend too.
+var fasthttpMetricsHandler fasthttp.RequestHandler
+
+// fasthttpRequestHandler routes to the same core handler functions the
+// net/http backend uses, reusing fasthttp's own RequestCtx pooling to keep
+// /bench allocation-free under load.
+func fasthttpRequestHandler(ctx *fasthttp.RequestCtx) {
+	c := &fasthttpCtx{ctx: ctx}
+	switch string(ctx.Path()) {
+	case "/metrics":
+		if fasthttpMetricsHandler != nil {
+			fasthttpMetricsHandler(ctx)
+			return
+		}
+		whoamiCore(c)
+	case "/data":
+		fasthttpDataHandler(c, ctx)
+	case "/bench":
+		benchCore(c)
+	case "/api":
+		apiCore(c)
+	case "/health":
+		healthCore(c)
+	default:
+		whoamiCore(c)
+	}
+}
+
+// fasthttpDataHandler mirrors dataHandler's net/http behavior as closely as
+// fasthttp allows. attachment downloads need http.ServeContent's Range
+// support, which fasthttp has no equivalent for, so they're rejected
+// outright rather than silently ignored. The stream case writes straight to
+// the connection via SetBodyStreamWriter instead of going through dataCore,
+// whose reqCtx.Write on fasthttp only appends to an in-memory response
+// buffer — without this, large streamed payloads would still be fully
+// buffered before being sent.
+func fasthttpDataHandler(c *fasthttpCtx, ctx *fasthttp.RequestCtx) {
+	if attachment, _ := strconv.ParseBool(c.Query("attachment")); attachment {
+		c.Error("attachment downloads are not supported by -server=fasthttp; use -server=net/http", http.StatusNotImplemented)
+		return
+	}
+
+	size, stream := dataStreamParams(c)
+	if !stream {
+		dataCore(c, nil)
+		return
+	}
+
+	c.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	c.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		_ = streamContentTo(w, size, func() { _ = w.Flush() })
+	})
+}
+
+func runFasthttpServer(addr string, metricsHandler http.Handler) error {
+	if metricsHandler != nil {
+		fasthttpMetricsHandler = fasthttpadaptor.NewFastHTTPHandler(metricsHandler)
+	}
+	server := &fasthttp.Server{
+		Handler: fasthttpRequestHandler,
+	}
+	return server.ListenAndServe(addr)
+}
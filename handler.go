@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"net/http"
+)
+
+// headerKV is a single request header, used by writeRawRequest to dump a
+// request back to the client regardless of which server backend served it.
+type headerKV struct {
+	Key   string
+	Value string
+}
+
+// reqCtx is the common surface benchCore, dataCore, whoamiCore, apiCore and
+// healthCore are written against, so each runs unchanged on both the
+// net/http and fasthttp backends (selected via -server). Each backend
+// supplies its own adapter implementing this interface.
+type reqCtx interface {
+	io.Writer
+
+	Method() string
+	Path() string
+	RequestURI() string
+	Query(key string) string
+	Header(key string) string
+	Headers() []headerKV
+	Host() string
+	RemoteAddr() string
+	RequestID() string
+	Body() io.Reader
+
+	SetHeader(key, value string)
+	SetStatusCode(code int)
+	Error(message string, statusCode int)
+}
+
+// netHTTPCtx adapts an http.ResponseWriter/http.Request pair to reqCtx.
+type netHTTPCtx struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func newNetHTTPCtx(w http.ResponseWriter, r *http.Request) *netHTTPCtx {
+	return &netHTTPCtx{w: w, r: r}
+}
+
+func (c *netHTTPCtx) Write(p []byte) (int, error)    { return c.w.Write(p) }
+func (c *netHTTPCtx) Method() string                 { return c.r.Method }
+func (c *netHTTPCtx) Path() string                   { return c.r.URL.Path }
+func (c *netHTTPCtx) RequestURI() string             { return c.r.URL.RequestURI() }
+func (c *netHTTPCtx) Query(key string) string        { return c.r.URL.Query().Get(key) }
+func (c *netHTTPCtx) Header(key string) string       { return c.r.Header.Get(key) }
+func (c *netHTTPCtx) Host() string                   { return c.r.Host }
+func (c *netHTTPCtx) RemoteAddr() string             { return c.r.RemoteAddr }
+func (c *netHTTPCtx) RequestID() string              { return requestIDFromContext(c.r.Context()) }
+func (c *netHTTPCtx) Body() io.Reader                { return c.r.Body }
+func (c *netHTTPCtx) SetHeader(key, value string)    { c.w.Header().Set(key, value) }
+func (c *netHTTPCtx) SetStatusCode(code int)         { c.w.WriteHeader(code) }
+func (c *netHTTPCtx) Error(message string, code int) { http.Error(c.w, message, code) }
+
+func (c *netHTTPCtx) Headers() []headerKV {
+	headers := make([]headerKV, 0, len(c.r.Header))
+	for key, values := range c.r.Header {
+		for _, value := range values {
+			headers = append(headers, headerKV{Key: key, Value: value})
+		}
+	}
+	return headers
+}
+
+// writeRawRequest writes a minimal HTTP/1.1 request dump to ctx, standing in
+// for the net/http-specific (*http.Request).Write used by the previous
+// whoamiHandler so the same core logic works for both server backends.
+func writeRawRequest(ctx reqCtx) error {
+	if _, err := ctx.Write([]byte(ctx.Method() + " " + ctx.RequestURI() + " HTTP/1.1\r\n")); err != nil {
+		return err
+	}
+	if _, err := ctx.Write([]byte("Host: " + ctx.Host() + "\r\n")); err != nil {
+		return err
+	}
+	for _, h := range ctx.Headers() {
+		if _, err := ctx.Write([]byte(h.Key + ": " + h.Value + "\r\n")); err != nil {
+			return err
+		}
+	}
+	_, err := ctx.Write([]byte("\r\n"))
+	return err
+}
+
+// headersMap reassembles a flat header list back into an http.Header, for
+// handlers (like apiHandler) whose JSON output shape predates reqCtx.
+func headersMap(headers []headerKV) http.Header {
+	h := make(http.Header, len(headers))
+	for _, kv := range headers {
+		h.Add(kv.Key, kv.Value)
+	}
+	return h
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resetHealthState() {
+	mutexHealthState.Lock()
+	if healthTransitionsCancel != nil {
+		healthTransitionsCancel()
+		healthTransitionsCancel = nil
+	}
+	currentHealthState = healthState{StatusCode: http.StatusOK}
+	mutexHealthState.Unlock()
+}
+
+func TestNewHealthStateFromSpecDefaults(t *testing.T) {
+	state, err := newHealthStateFromSpec(healthStateSpec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", state.StatusCode, http.StatusOK)
+	}
+	if state.FailStatus != http.StatusServiceUnavailable {
+		t.Errorf("FailStatus = %d, want %d", state.FailStatus, http.StatusServiceUnavailable)
+	}
+}
+
+func TestNewHealthStateFromSpecInvalidLatency(t *testing.T) {
+	if _, err := newHealthStateFromSpec(healthStateSpec{Latency: "not-a-duration"}); err == nil {
+		t.Fatal("expected an error for an invalid latency")
+	}
+}
+
+func TestNewHealthStateFromSpecInvalidTransition(t *testing.T) {
+	spec := healthStateSpec{Transitions: []healthTransitionSpec{{After: "not-a-duration", Status: 500}}}
+	if _, err := newHealthStateFromSpec(spec); err == nil {
+		t.Fatal("expected an error for an invalid transition duration")
+	}
+}
+
+func TestNewHealthStateFromSpecPreservesTransitionOrder(t *testing.T) {
+	spec := healthStateSpec{
+		Transitions: []healthTransitionSpec{
+			{After: "10ms", Status: 500},
+			{After: "20ms", Status: 200},
+			{After: "5ms", Status: 503},
+		},
+	}
+	state, err := newHealthStateFromSpec(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []int{500, 200, 503}
+	for i, tr := range state.Transitions {
+		if tr.Status != want[i] {
+			t.Errorf("Transitions[%d].Status = %d, want %d", i, tr.Status, want[i])
+		}
+	}
+}
+
+// TestHealthCoreBackwardCompatBareInt covers the legacy wire format: POST
+// /health with a bare JSON integer body, predating healthStateSpec.
+func TestHealthCoreBackwardCompatBareInt(t *testing.T) {
+	defer resetHealthState()
+
+	req := httptest.NewRequest(http.MethodPost, "/health", strings.NewReader("503"))
+	rec := httptest.NewRecorder()
+	healthCore(newNetHTTPCtx(rec, req))
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec = httptest.NewRecorder()
+	healthCore(newNetHTTPCtx(rec, req))
+	if rec.Code != 503 {
+		t.Errorf("GET /health status = %d, want 503", rec.Code)
+	}
+}
+
+func TestHealthCoreJSONSpecLatency(t *testing.T) {
+	defer resetHealthState()
+
+	body, _ := json.Marshal(healthStateSpec{Status: 201, Latency: "20ms"})
+	req := httptest.NewRequest(http.MethodPost, "/health", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	healthCore(newNetHTTPCtx(rec, req))
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec = httptest.NewRecorder()
+	start := time.Now()
+	healthCore(newNetHTTPCtx(rec, req))
+	elapsed := time.Since(start)
+
+	if rec.Code != 201 {
+		t.Errorf("GET /health status = %d, want 201", rec.Code)
+	}
+	if elapsed < 20*time.Millisecond {
+		t.Errorf("GET /health returned after %s, want at least the 20ms configured latency", elapsed)
+	}
+}
+
+func TestHealthCoreTransitionsApplyInOrder(t *testing.T) {
+	defer resetHealthState()
+
+	body, _ := json.Marshal(healthStateSpec{
+		Status: 200,
+		Transitions: []healthTransitionSpec{
+			{After: "40ms", Status: 201},
+			{After: "60ms", Status: 202},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/health", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	healthCore(newNetHTTPCtx(rec, req))
+
+	statusAfter := func(sleep time.Duration) int {
+		time.Sleep(sleep)
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		rec := httptest.NewRecorder()
+		healthCore(newNetHTTPCtx(rec, req))
+		return rec.Code
+	}
+
+	if got := statusAfter(0); got != 200 {
+		t.Errorf("status before any transition = %d, want 200", got)
+	}
+	if got := statusAfter(60 * time.Millisecond); got != 201 {
+		t.Errorf("status after first transition = %d, want 201", got)
+	}
+	if got := statusAfter(60 * time.Millisecond); got != 202 {
+		t.Errorf("status after second transition = %d, want 202", got)
+	}
+}
+
+func TestHealthCoreShuttingDown(t *testing.T) {
+	defer resetHealthState()
+	defer func() { shuttingDown = 0 }()
+
+	beginShutdown()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec := httptest.NewRecorder()
+	healthCore(newNetHTTPCtx(rec, req))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status while shutting down = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
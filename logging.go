@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported values for -log-format.
+const (
+	logFormatJSON   = "json"
+	logFormatLogfmt = "logfmt"
+	logFormatCLF    = "clf"
+	requestIDHeader = "X-Request-ID"
+)
+
+type contextKey string
+
+const requestIDContextKey contextKey = "requestID"
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+func generateRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// openAccessLogWriter resolves -log-output into a writer: "stdout",
+// "stderr", or "file:<path>" appended to.
+func openAccessLogWriter(dest string) (io.Writer, error) {
+	switch dest {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	if path, ok := strings.CutPrefix(dest, "file:"); ok {
+		return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	return nil, fmt.Errorf("invalid -log-output %q: must be stdout, stderr or file:<path>", dest)
+}
+
+// loggingMiddleware is a sibling of metricsMiddleware: it wraps the
+// response writer the same way to capture status and byte count, assigns a
+// request ID (reusing one supplied by the client), and emits one structured
+// record per request in the format selected by -log-format.
+type loggingMiddleware struct {
+	nextHandler http.HandlerFunc
+	writer      io.Writer
+}
+
+func (m loggingMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+	w.Header().Set(requestIDHeader, requestID)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, requestID))
+
+	start := time.Now()
+	rw := newResponseWriterWrapper(w)
+	m.nextHandler(rw, r)
+
+	record := accessLogRecord{
+		Time:       start,
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Status:     rw.status,
+		Bytes:      rw.bytesWritten,
+		Duration:   time.Since(start),
+		UserAgent:  r.UserAgent(),
+		Referer:    r.Referer(),
+		RequestID:  requestID,
+	}
+	_, _ = fmt.Fprintln(m.writer, record.format(logFormat))
+}
+
+type accessLogRecord struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	Path       string
+	Status     int
+	Bytes      int
+	Duration   time.Duration
+	UserAgent  string
+	Referer    string
+	RequestID  string
+}
+
+func (r accessLogRecord) format(format string) string {
+	switch format {
+	case logFormatLogfmt:
+		return r.logfmt()
+	case logFormatCLF:
+		return r.clf()
+	default:
+		return r.json()
+	}
+}
+
+func (r accessLogRecord) json() string {
+	data, err := json.Marshal(struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remoteAddr"`
+		Method     string  `json:"method"`
+		Path       string  `json:"path"`
+		Status     int     `json:"status"`
+		Bytes      int     `json:"bytes"`
+		DurationMs float64 `json:"durationMs"`
+		UserAgent  string  `json:"userAgent,omitempty"`
+		Referer    string  `json:"referer,omitempty"`
+		RequestID  string  `json:"requestId"`
+	}{
+		Time:       r.Time.Format(time.RFC3339),
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		Path:       r.Path,
+		Status:     r.Status,
+		Bytes:      r.Bytes,
+		DurationMs: durationMs(r.Duration),
+		UserAgent:  r.UserAgent,
+		Referer:    r.Referer,
+		RequestID:  r.RequestID,
+	})
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
+
+func (r accessLogRecord) logfmt() string {
+	return fmt.Sprintf(
+		"time=%s remoteAddr=%s method=%s path=%q status=%d bytes=%d durationMs=%.3f userAgent=%q referer=%q requestId=%s",
+		r.Time.Format(time.RFC3339), r.RemoteAddr, r.Method, r.Path, r.Status, r.Bytes,
+		durationMs(r.Duration), r.UserAgent, r.Referer, r.RequestID,
+	)
+}
+
+func (r accessLogRecord) clf() string {
+	return fmt.Sprintf(
+		`%s - - [%s] "%s %s HTTP/1.1" %d %d "%s" "%s"`,
+		r.RemoteAddr, r.Time.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.Path, r.Status, r.Bytes, r.Referer, r.UserAgent,
+	)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAccessLogRecord() accessLogRecord {
+	return accessLogRecord{
+		Time:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		RemoteAddr: "203.0.113.1:1234",
+		Method:     "GET",
+		Path:       "/whoami?x=1",
+		Status:     200,
+		Bytes:      42,
+		Duration:   1500 * time.Microsecond,
+		UserAgent:  "curl/8.0",
+		Referer:    "https://example.com",
+		RequestID:  "abc123",
+	}
+}
+
+func TestAccessLogRecordFormatJSON(t *testing.T) {
+	r := testAccessLogRecord()
+	out := r.format(logFormatJSON)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("format(json) produced invalid JSON: %v\noutput: %s", err, out)
+	}
+	if decoded["requestId"] != "abc123" {
+		t.Errorf("requestId = %v, want abc123", decoded["requestId"])
+	}
+	if decoded["status"].(float64) != 200 {
+		t.Errorf("status = %v, want 200", decoded["status"])
+	}
+	if decoded["durationMs"].(float64) != 1.5 {
+		t.Errorf("durationMs = %v, want 1.5", decoded["durationMs"])
+	}
+}
+
+func TestAccessLogRecordFormatLogfmt(t *testing.T) {
+	r := testAccessLogRecord()
+	out := r.format(logFormatLogfmt)
+
+	for _, want := range []string{
+		"method=GET", "status=200", "bytes=42", "requestId=abc123", `path="/whoami?x=1"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("format(logfmt) = %q, missing %q", out, want)
+		}
+	}
+}
+
+func TestAccessLogRecordFormatCLF(t *testing.T) {
+	r := testAccessLogRecord()
+	out := r.format(logFormatCLF)
+
+	want := `203.0.113.1:1234 - - [02/Jan/2026:03:04:05 +0000] "GET /whoami?x=1 HTTP/1.1" 200 42 "https://example.com" "curl/8.0"`
+	if out != want {
+		t.Errorf("format(clf) = %q, want %q", out, want)
+	}
+}
+
+func TestAccessLogRecordFormatDefaultsToJSON(t *testing.T) {
+	r := testAccessLogRecord()
+	if r.format("unknown") != r.format(logFormatJSON) {
+		t.Error("format with an unrecognized format should fall back to json")
+	}
+}
+
+func TestDurationMs(t *testing.T) {
+	if got := durationMs(1500 * time.Microsecond); got != 1.5 {
+		t.Errorf("durationMs(1500us) = %v, want 1.5", got)
+	}
+}
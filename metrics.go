@@ -1,38 +1,194 @@
 package main
 
 import (
+	"bufio"
 	"expvar"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Supported values for -metrics-format.
+const (
+	metricsFormatExpvar     = "expvar"
+	metricsFormatPrometheus = "prometheus"
+	metricsFormatBoth       = "both"
 )
 
 var totalRequestCount expvarInt
 var concurrentRequestCount expvarInt
 var maxConcurrentRequestCount expvarMaxInt
+var wsActiveConnections expvarInt
 
 func publishExpvarMetrics() {
 	metrics := expvar.Map{}
 	metrics.Set("totalRequestCount", &totalRequestCount)
 	metrics.Set("concurrentRequestCount", &concurrentRequestCount)
 	metrics.Set("maxConcurrentRequestCount", &maxConcurrentRequestCount)
+	metrics.Set("wsActiveConnections", &wsActiveConnections)
 	expvar.Publish("metrics", &metrics)
 }
 
+var (
+	promRegistry      = prometheus.NewRegistry()
+	requestsTotal     *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	responseSizeBytes *prometheus.HistogramVec
+	requestsInFlight  *prometheus.GaugeVec
+)
+
+// publishPrometheusMetrics registers the collectors used by metricsMiddleware
+// and returns the handler to serve them on /metrics.
+func publishPrometheusMetrics(buckets []float64) http.Handler {
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whoami_requests_total",
+		Help: "Total number of HTTP requests processed, labeled by path, method and status.",
+	}, []string{"path", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "whoami_request_duration_seconds",
+		Help:    "HTTP request duration in seconds, labeled by path and method.",
+		Buckets: buckets,
+	}, []string{"path", "method"})
+
+	responseSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "whoami_response_size_bytes",
+		Help:    "HTTP response size in bytes, labeled by path and method.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"path", "method"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "whoami_requests_in_flight",
+		Help: "Number of HTTP requests currently being served, labeled by path.",
+	}, []string{"path"})
+
+	promRegistry.MustRegister(requestsTotal, requestDuration, responseSizeBytes, requestsInFlight)
+	return promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
+}
+
+// parseMetricsBuckets parses a comma-separated list of seconds (e.g.
+// "0.01,0.05,0.1,0.5,1") into histogram bucket boundaries, falling back to
+// the Prometheus client's default buckets when the flag is empty or
+// unparsable.
+func parseMetricsBuckets(s string) []float64 {
+	if strings.TrimSpace(s) == "" {
+		return prometheus.DefBuckets
+	}
+	parts := strings.Split(s, ",")
+	buckets := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, v)
+	}
+	if len(buckets) == 0 {
+		return prometheus.DefBuckets
+	}
+	return buckets
+}
+
 type metricsMiddleware struct {
 	nextHandler http.HandlerFunc
+	path        string
 }
 
 func (m metricsMiddleware) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	m.onHandleRequestStart()
 	defer m.onHandleRequestFinish()
-	m.nextHandler(writer, request)
+
+	recordPrometheus := metricsFormat == metricsFormatPrometheus || metricsFormat == metricsFormatBoth
+	if recordPrometheus {
+		requestsInFlight.WithLabelValues(m.path).Inc()
+		defer requestsInFlight.WithLabelValues(m.path).Dec()
+	}
+
+	start := time.Now()
+	rw := newResponseWriterWrapper(writer)
+	m.nextHandler(rw, request)
+
+	if recordPrometheus {
+		status := strconv.Itoa(rw.status)
+		requestsTotal.WithLabelValues(m.path, request.Method, status).Inc()
+		requestDuration.WithLabelValues(m.path, request.Method).Observe(time.Since(start).Seconds())
+		responseSizeBytes.WithLabelValues(m.path, request.Method).Observe(float64(rw.bytesWritten))
+	}
 }
 
 func (m metricsMiddleware) onHandleRequestStart() {
-	count := concurrentRequestCount.Add(1)
-	totalRequestCount.Add(1)
-	maxConcurrentRequestCount.Update(count)
+	if metricsFormat == metricsFormatExpvar || metricsFormat == metricsFormatBoth {
+		count := concurrentRequestCount.Add(1)
+		totalRequestCount.Add(1)
+		maxConcurrentRequestCount.Update(count)
+	}
 }
 
 func (m metricsMiddleware) onHandleRequestFinish() {
-	concurrentRequestCount.Add(-1)
+	if metricsFormat == metricsFormatExpvar || metricsFormat == metricsFormatBoth {
+		concurrentRequestCount.Add(-1)
+	}
+}
+
+// responseWriterWrapper wraps an http.ResponseWriter to capture the status
+// code and number of bytes written. It is shared by the metrics and access
+// logging middleware so both can observe the same request without wrapping
+// the writer twice.
+type responseWriterWrapper struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int
+}
+
+func newResponseWriterWrapper(w http.ResponseWriter) *responseWriterWrapper {
+	if rw, ok := w.(*responseWriterWrapper); ok {
+		return rw
+	}
+	return &responseWriterWrapper{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *responseWriterWrapper) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriterWrapper) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += n
+	return n, err
+}
+
+// Hijack forwards to the underlying ResponseWriter's http.Hijacker so
+// websocket upgrades (see echoHandler) keep working when the writer is
+// wrapped for metrics/access logging.
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Flush forwards to the underlying ResponseWriter's http.Flusher so
+// /data?stream=true can still flush chunks as they're written when the
+// writer is wrapped for metrics/access logging.
+func (w *responseWriterWrapper) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push forwards to the underlying ResponseWriter's http.Pusher for HTTP/2
+// server push, consistent with the Hijack/Flush passthroughs above.
+func (w *responseWriterWrapper) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseMetricsBuckets(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []float64
+	}{
+		{"empty falls back to defaults", "", prometheus.DefBuckets},
+		{"blank falls back to defaults", "   ", prometheus.DefBuckets},
+		{"single value", "0.5", []float64{0.5}},
+		{"multiple values", "0.01,0.05,0.1,0.5,1", []float64{0.01, 0.05, 0.1, 0.5, 1}},
+		{"trims whitespace around values", " 0.1 , 0.2 ", []float64{0.1, 0.2}},
+		{"skips unparsable entries", "0.1,nope,0.2", []float64{0.1, 0.2}},
+		{"all unparsable falls back to defaults", "nope,also-nope", prometheus.DefBuckets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMetricsBuckets(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMetricsBuckets(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
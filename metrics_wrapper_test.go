@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriterWrapperForwardsFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := newResponseWriterWrapper(rec)
+
+	flusher, ok := http.ResponseWriter(rw).(http.Flusher)
+	if !ok {
+		t.Fatal("responseWriterWrapper does not implement http.Flusher")
+	}
+	flusher.Flush()
+
+	if !rec.Flushed {
+		t.Error("Flush() on the wrapper did not reach the underlying ResponseWriter")
+	}
+}
+
+func TestResponseWriterWrapperForwardsHijack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriterWrapper(w)
+
+		hijacker, ok := http.ResponseWriter(rw).(http.Hijacker)
+		if !ok {
+			t.Error("responseWriterWrapper does not implement http.Hijacker")
+			return
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("Hijack() through the wrapper failed: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestBeginShutdownFlipsIsShuttingDown(t *testing.T) {
+	defer func() { shuttingDown = 0 }()
+
+	if isShuttingDown() {
+		t.Fatal("isShuttingDown() = true before beginShutdown was called")
+	}
+
+	beginShutdown()
+	if !isShuttingDown() {
+		t.Fatal("isShuttingDown() = false after beginShutdown")
+	}
+
+	// Calling it again should be a no-op, not panic or flip back.
+	beginShutdown()
+	if !isShuttingDown() {
+		t.Fatal("isShuttingDown() = false after a second beginShutdown")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAcquireWSConnRespectsCap(t *testing.T) {
+	defer func() { wsConnCount = 0; wsMaxConns = 1000 }()
+
+	wsConnCount = 0
+	wsMaxConns = 2
+
+	if !acquireWSConn() {
+		t.Fatal("first acquire should succeed")
+	}
+	if !acquireWSConn() {
+		t.Fatal("second acquire should succeed")
+	}
+	if acquireWSConn() {
+		t.Fatal("third acquire should fail once the cap is reached")
+	}
+
+	releaseWSConn()
+	if !acquireWSConn() {
+		t.Fatal("acquire should succeed again after a release frees a slot")
+	}
+}
+
+func TestAcquireWSConnUnlimitedWhenCapIsZero(t *testing.T) {
+	defer func() { wsConnCount = 0; wsMaxConns = 1000 }()
+
+	wsConnCount = 0
+	wsMaxConns = 0
+
+	for i := 0; i < 10_000; i++ {
+		if !acquireWSConn() {
+			t.Fatalf("acquire %d should succeed when -ws-max-conns=0", i)
+		}
+	}
+}
+
+func TestAcquireWSConnConcurrentNeverExceedsCap(t *testing.T) {
+	defer func() { wsConnCount = 0; wsMaxConns = 1000 }()
+
+	wsConnCount = 0
+	wsMaxConns = 10
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if acquireWSConn() {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 10 {
+		t.Errorf("accepted %d connections, want exactly %d (=-ws-max-conns)", accepted, 10)
+	}
+}
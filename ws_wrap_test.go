@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEchoWebsocketThroughWrapHandlerWithMetricsAndLogging is a regression
+// test for responseWriterWrapper not forwarding http.Hijacker: with
+// -metrics and -access-log both on, wrapHandler wraps /echo in both
+// middlewares, and the websocket upgrade must still succeed.
+func TestEchoWebsocketThroughWrapHandlerWithMetricsAndLogging(t *testing.T) {
+	prevMetricsEnabled, prevAccessLogEnabled := metricsEnabled, accessLogEnabled
+	prevMetricsFormat, prevAccessLogWriter := metricsFormat, accessLogWriter
+	defer func() {
+		metricsEnabled, accessLogEnabled = prevMetricsEnabled, prevAccessLogEnabled
+		metricsFormat, accessLogWriter = prevMetricsFormat, prevAccessLogWriter
+	}()
+
+	metricsEnabled = true
+	metricsFormat = metricsFormatExpvar
+	accessLogEnabled = true
+	accessLogWriter = io.Discard
+
+	server := httptest.NewServer(wrapHandler("/echo", echoHandler))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/echo"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("websocket dial through a metrics+logging-wrapped handler failed: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(msg) != "ping" {
+		t.Errorf("echoed message = %q, want %q", msg, "ping")
+	}
+}